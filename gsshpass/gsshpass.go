@@ -2,18 +2,34 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"flag"
 	"fmt"
-
-	"golang.org/x/crypto/ssh"
-
-	// "golang.org/x/term"
+	"io"
 	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
 	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/scottpeterman/sshwontdie/runner"
 )
 
+// defaultKnownHosts mirrors OpenSSH's own default of ~/.ssh/known_hosts, so
+// that leaving -known-hosts unset verifies host keys against the same file
+// ssh(1) uses. It's empty if the home directory can't be
+// resolved, in which case -known-hosts must be passed explicitly.
+func defaultKnownHosts() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".ssh", "known_hosts")
+}
+
 func main() {
 	host := flag.String("h", "", "SSH Host (ip:port)")
 	user := flag.String("u", "", "SSH Username")
@@ -23,82 +39,80 @@ func main() {
 	prompt := flag.String("prompt", "", "Prompt to look for before breaking the shell")
 	promptCount := flag.Int("prompt-count", 1, "Number of prompts to look for before breaking the shell")
 	timeoutDuration := flag.Int("t", 5, "Command timeout duration in seconds")
+	identity := flag.String("i", "", "Path to private key file for public key authentication")
+	passphrase := flag.String("passphrase", "", "Passphrase for the private key, if encrypted")
+	useAgent := flag.Bool("agent", false, "Use the running ssh-agent (SSH_AUTH_SOCK) for authentication")
+	knownHosts := flag.String("known-hosts", defaultKnownHosts(), "Path to a known_hosts file to verify host keys against")
+	strictHostKey := flag.String("strict-host-key", "accept-new", "Host key verification mode: yes|no|ask|accept-new")
+	hostKeyAlgorithms := flag.String("host-key-algorithms", "", "Comma-separated list of accepted host key algorithms")
+	sudoPassword := flag.String("sudo-password", "", "Password to answer sudo/privilege-escalation prompts with, if different from -p")
+	sudoRetries := flag.Int("sudo-retries", 1, "Maximum number of times to answer a sudo/password prompt, to avoid lockouts")
+	sudoPromptPattern := flag.String("sudo-prompt", "", "Regex matching a sudo/privilege-escalation password prompt")
+	scriptFile := flag.String("script", "", "Path to a YAML/JSON script of {send, expect, timeout, optional} steps, run in invoke-shell mode")
+	inventory := flag.String("inventory", "", "Path to a CSV/YAML host inventory; runs -c against every host concurrently and exits")
+	workers := flag.Int("workers", 4, "Maximum concurrent hosts when -inventory is set")
+	deadline := flag.Duration("deadline", 5*time.Minute, "Overall time budget for an -inventory run")
+	sftpPut := flag.String("put", "", "local:remote path to upload via SFTP (recurses if local is a directory)")
+	sftpGet := flag.String("get", "", "remote:local path to download via SFTP (recurses if remote is a directory)")
+	localForward := flag.String("L", "", "Local port forward, local_port:host:hostport (like ssh -L)")
+	remoteForward := flag.String("R", "", "Remote port forward, remote_port:host:hostport (like ssh -R)")
+	recordCast := flag.String("record", "", "Path to write an asciinema v2 cast of an -invoke-shell session")
+	typescriptFile := flag.String("typescript", "", "Path to write a plain-text typescript of an -invoke-shell session")
 
 	flag.Parse()
 
-	// add keyboard ineractive support:
-	config := &ssh.ClientConfig{
-		User: *user,
-		Auth: []ssh.AuthMethod{
-			// Try password authentication first.
-			ssh.Password(*password),
-			// Fallback to keyboard-interactive authentication.
-			ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
-				fmt.Println("KeyboardInteractive...")
-				answers := make([]string, len(questions))
-				reader := bufio.NewReader(os.Stdin)
-
-				fmt.Println(instruction) // Print any instruction given by the server.
-
-				for i, question := range questions {
-					fmt.Println("Question:")
-					fmt.Print(question) // Print the question to the user.
-
-					if !echos[i] {
-						// If the echo is false, it's likely asking for a password, so we should not echo the input.
-						// answerBytes, err := term.ReadPassword(int(os.Stdin.Fd()))
-
-						if strings.Contains(strings.ToLower(question), "password") {
-							answers[i] = *password
-						}
-					} else {
-						// For other inputs, it's okay to echo what the user types.
-						answer, err := reader.ReadString('\n')
-						if err != nil {
-							return nil, err
-						}
-						answers[i] = strings.TrimSpace(answer)
-					}
-				}
-				// fmt.Println("Answers:")
-				// fmt.Println(answers)
-				return answers, nil
-			}),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         time.Duration(*timeoutDuration) * time.Second,
-		ClientVersion:   "SSH-2.0-Go",
-		Config: ssh.Config{
-			Ciphers: []string{
-				"aes128-ctr",
-				"aes192-ctr",
-				"aes256-ctr",
-				"aes128-gcm@openssh.com",
-				"aes256-gcm@openssh.com",
-				"chacha20-poly1305@openssh.com", // Include this if supported by your Go SSH library
-				"aes128-cbc",                    // if this is first, Palo pukes
-
-			},
-			KeyExchanges: []string{
-				"curve25519-sha256@libssh.org",
-				"ecdh-sha2-nistp256",
-				"ecdh-sha2-nistp384",
-				"ecdh-sha2-nistp521",
-				"diffie-hellman-group-exchange-sha256",
-				"diffie-hellman-group16-sha512",
-				"diffie-hellman-group18-sha512",
-				"diffie-hellman-group14-sha256",
-				"diffie-hellman-group14-sha1",
-				"diffie-hellman-group1-sha1", // add this to allow the insecure algorithm
-				// ... (rest of your key exchange algorithms)
-			},
-		},
-		// Other configurations...
-	}
-
-	client, err := ssh.Dial("tcp", *host, config)
+	effectiveSudoPassword := *sudoPassword
+	if effectiveSudoPassword == "" {
+		effectiveSudoPassword = *password
+	}
+
+	opts := runner.Options{
+		UseAgent:          *useAgent,
+		KnownHosts:        *knownHosts,
+		StrictHostKey:     *strictHostKey,
+		Timeout:           time.Duration(*timeoutDuration) * time.Second,
+		SudoPromptPattern: *sudoPromptPattern,
+		SudoRetries:       *sudoRetries,
+	}
+	if *hostKeyAlgorithms != "" {
+		opts.HostKeyAlgorithms = strings.Split(*hostKeyAlgorithms, ",")
+	}
+	rn := runner.New(opts)
+
+	if *inventory != "" {
+		hosts, err := runner.LoadInventory(*inventory)
+		if err != nil {
+			log.Fatalf("Failed to load inventory %s: %s", *inventory, err)
+		}
+		if err := rn.RunFanOut(hosts, *cmds, runner.FanOutOptions{Workers: *workers, Deadline: *deadline}, os.Stdout); err != nil {
+			log.Fatalf("Fan-out run failed: %s", err)
+		}
+		return
+	}
+
+	spec := runner.HostSpec{
+		Host:         *host,
+		User:         *user,
+		Password:     *password,
+		Identity:     *identity,
+		Passphrase:   *passphrase,
+		SudoPassword: effectiveSudoPassword,
+	}
+
+	client, err := rn.Dial(spec)
 	if err != nil {
-		log.Fatalf("Failed to dial: %s", err)
+		log.Fatalf("%s", err)
+	}
+	defer client.Close()
+
+	if *sftpPut != "" || *sftpGet != "" {
+		runSFTP(client, *sftpPut, *sftpGet)
+		return
+	}
+
+	if *localForward != "" || *remoteForward != "" {
+		runForwards(client, *localForward, *remoteForward)
+		return
 	}
 
 	session, err := client.NewSession()
@@ -115,46 +129,233 @@ func main() {
 
 		stdoutPipe, _ := session.StdoutPipe()
 		stdinPipe, _ := session.StdinPipe()
-		reader := bufio.NewReader(stdoutPipe)
-		done := make(chan bool)
-		counter := 0
+		sudo := rn.NewSudoHandler(spec)
 
-		go func() {
-			for {
-				line, _ := reader.ReadString('\n')
-				fmt.Print(line)
-				if strings.Contains(line, *prompt) {
-					counter++
-					if counter >= *promptCount {
-						done <- true
-						break
+		recorders, closeRecorders := openSessionRecorders(*recordCast, *typescriptFile)
+		defer closeRecorders()
+		if len(recorders) > 0 {
+			stdoutPipe = io.TeeReader(stdoutPipe, io.MultiWriter(recorders...))
+		}
+
+		if *scriptFile != "" {
+			// Structured driver: each step is sent only once the previous
+			// step's expect pattern has matched, so prompt changes (enable
+			// mode, config mode, sudo su) don't desync a fixed sleep loop.
+			steps, err := runner.LoadScript(*scriptFile)
+			if err != nil {
+				log.Fatalf("Failed to load script %s: %s", *scriptFile, err)
+			}
+
+			if err := session.Shell(); err != nil {
+				log.Fatalf("Failed to start shell: %s", err)
+			}
+
+			if err := runner.RunScript(stdoutPipe, stdinPipe, steps, sudo); err != nil {
+				log.Fatalf("Script %s failed: %s", *scriptFile, err)
+			}
+		} else {
+			reader := bufio.NewReader(stdoutPipe)
+			done := make(chan bool)
+			counter := 0
+
+			go func() {
+				buf := make([]byte, 4096)
+				// accum is a bounded sliding window, not a full transcript:
+				// prompt/sudo matches only ever need recent context, so it's
+				// capped rather than growing for the life of a long session.
+				const accumCap = 8192
+				var accum []byte
+				for {
+					n, err := reader.Read(buf)
+					if n > 0 {
+						chunk := buf[:n]
+						os.Stdout.Write(chunk)
+						accum = append(accum, chunk...)
+						if len(accum) > accumCap {
+							accum = accum[len(accum)-accumCap:]
+						}
+						text := string(accum)
+						switch {
+						case sudo.MaybeAnswer(text, stdinPipe):
+							accum = accum[:0]
+						case strings.Contains(text, *prompt):
+							accum = accum[:0]
+							counter++
+							if counter >= *promptCount {
+								done <- true
+								return
+							}
+						}
+					}
+					if err != nil {
+						return
 					}
 				}
+			}()
+
+			if err := session.Shell(); err != nil {
+				log.Fatalf("Failed to start shell: %s", err)
+			}
+
+			commands := strings.Split(*cmds, ",")
+			for _, command := range commands {
+				fmt.Fprintf(stdinPipe, "%s\n", command)
+				time.Sleep(1 * time.Second)
 			}
-		}()
 
-		if err := session.Shell(); err != nil {
-			log.Fatalf("Failed to start shell: %s", err)
+			select {
+			case <-done:
+				fmt.Println("Exiting due to prompt.")
+			case <-time.After(time.Duration(*timeoutDuration) * time.Second):
+				fmt.Println("Exiting due to seconds timeout.")
+			}
+		}
+	} else {
+		// Exec-only logic here. Always run through runner.RunExecWithSudo,
+		// so a "[sudo] password for ...:" prompt on
+		// stdout or stderr can be answered on stdin instead of hanging
+		// CombinedOutput forever.
+		sudo := rn.NewSudoHandler(spec)
+		out, errOut, err := runner.RunExecWithSudo(session, *cmds, sudo)
+		if errOut != "" {
+			fmt.Fprint(os.Stderr, errOut)
+		}
+		if err != nil {
+			log.Fatalf("Failed to run command: %s", err)
 		}
+		fmt.Println(out)
+	}
+}
 
-		commands := strings.Split(*cmds, ",")
-		for _, command := range commands {
-			fmt.Fprintf(stdinPipe, "%s\n", command)
-			time.Sleep(1 * time.Second)
+// openSessionRecorders builds the writers an -invoke-shell session's output
+// should be teed through: an asciinema cast and/or a plain-text typescript,
+// whichever were requested. It's used in both invoke-shell branches (the
+// free-form prompt loop and the -script driver) by wrapping stdoutPipe in an
+// io.TeeReader over io.MultiWriter(recorders...), so recording doesn't depend
+// on which branch is reading the session's output. The returned func closes
+// any files opened and must be deferred by the caller.
+func openSessionRecorders(castPath, typescriptPath string) ([]io.Writer, func()) {
+	var writers []io.Writer
+	var closers []func() error
+
+	if castPath != "" {
+		f, err := os.Create(castPath)
+		if err != nil {
+			log.Fatalf("Failed to create cast file %s: %s", castPath, err)
 		}
 
-		select {
-		case <-done:
-			fmt.Println("Exiting due to prompt.")
-		case <-time.After(time.Duration(*timeoutDuration) * time.Second):
-			fmt.Println("Exiting due to seconds timeout.")
+		rec, err := runner.NewCastRecorder(f, 120, 80)
+		if err != nil {
+			log.Fatalf("Failed to start cast recording: %s", err)
 		}
-	} else {
-		// Exec-only logic here
-		out, err := session.CombinedOutput(*cmds)
+		writers = append(writers, rec)
+		// rec.Flush must run before f.Close, so a trailing partial rune
+		// Write was still holding back gets written out.
+		closers = append(closers, rec.Flush, f.Close)
+	}
+
+	if typescriptPath != "" {
+		f, err := os.Create(typescriptPath)
 		if err != nil {
-			log.Fatalf("Failed to run command: %s", err)
+			log.Fatalf("Failed to create typescript file %s: %s", typescriptPath, err)
+		}
+		closers = append(closers, f.Close)
+		writers = append(writers, f)
+	}
+
+	return writers, func() {
+		for _, closeFn := range closers {
+			closeFn()
+		}
+	}
+}
+
+// runSFTP handles the -put/-get modes: local:remote and remote:local path
+// pairs transferred over a single SFTP session on client.
+func runSFTP(client *ssh.Client, put, get string) {
+	sftpClient, err := runner.NewSFTPClient(client)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	defer sftpClient.Close()
+
+	progress := func(path string, transferred int64) {
+		fmt.Printf("%s (%d bytes)\n", path, transferred)
+	}
+
+	if put != "" {
+		local, remote, err := splitPathPair(put)
+		if err != nil {
+			log.Fatalf("Invalid -put value %q: %s", put, err)
+		}
+		if err := runner.Put(sftpClient, local, remote, progress); err != nil {
+			log.Fatalf("Failed to upload %s: %s", local, err)
 		}
-		fmt.Println(string(out))
 	}
+
+	if get != "" {
+		remote, local, err := splitPathPair(get)
+		if err != nil {
+			log.Fatalf("Invalid -get value %q: %s", get, err)
+		}
+		if err := runner.Get(sftpClient, remote, local, progress); err != nil {
+			log.Fatalf("Failed to download %s: %s", remote, err)
+		}
+	}
+}
+
+// splitPathPair splits a "source:destination" flag value into its two parts.
+func splitPathPair(spec string) (string, string, error) {
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("expected source:destination")
+	}
+	return parts[0], parts[1], nil
+}
+
+// runForwards handles the -L/-R modes: it sets up the requested tunnels and
+// blocks until interrupted (Ctrl-C), copying bytes in both directions for
+// every connection in the meantime.
+func runForwards(client *ssh.Client, localSpec, remoteSpec string) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if localSpec != "" {
+		localAddr, remoteAddr, err := parseForwardSpec(localSpec)
+		if err != nil {
+			log.Fatalf("Invalid -L value %q: %s", localSpec, err)
+		}
+		go func() {
+			if err := runner.LocalForward(ctx, client, localAddr, remoteAddr); err != nil {
+				log.Printf("Local forward %s failed: %s", localSpec, err)
+			}
+		}()
+		fmt.Printf("Forwarding local %s to %s\n", localAddr, remoteAddr)
+	}
+
+	if remoteSpec != "" {
+		remoteAddr, localAddr, err := parseForwardSpec(remoteSpec)
+		if err != nil {
+			log.Fatalf("Invalid -R value %q: %s", remoteSpec, err)
+		}
+		go func() {
+			if err := runner.RemoteForward(ctx, client, remoteAddr, localAddr); err != nil {
+				log.Printf("Remote forward %s failed: %s", remoteSpec, err)
+			}
+		}()
+		fmt.Printf("Forwarding remote %s to %s\n", remoteAddr, localAddr)
+	}
+
+	<-ctx.Done()
+	fmt.Println("Forwarding stopped.")
+}
+
+// parseForwardSpec splits a "local_port:host:hostport" flag value (the
+// format ssh -L/-R use) into a listen address and a destination address.
+func parseForwardSpec(spec string) (listenAddr, destAddr string, err error) {
+	parts := strings.SplitN(spec, ":", 3)
+	if len(parts) != 3 {
+		return "", "", fmt.Errorf("expected port:host:port")
+	}
+	return ":" + parts[0], parts[1] + ":" + parts[2], nil
 }
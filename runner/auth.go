@@ -0,0 +1,86 @@
+package runner
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// buildAuthMethods assembles the ordered list of ssh.AuthMethod the client
+// will offer the server. Public key and ssh-agent auth (when requested) are
+// tried before password/keyboard-interactive, matching how OpenSSH clients
+// prefer non-interactive credentials over prompting.
+func buildAuthMethods(spec HostSpec, useAgent bool) ([]ssh.AuthMethod, error) {
+	var methods []ssh.AuthMethod
+
+	if useAgent {
+		sock := os.Getenv("SSH_AUTH_SOCK")
+		if sock == "" {
+			return nil, fmt.Errorf("agent auth requested but SSH_AUTH_SOCK is not set")
+		}
+		conn, err := net.Dial("unix", sock)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to ssh-agent at %s: %w", sock, err)
+		}
+		agentClient := agent.NewClient(conn)
+		methods = append(methods, ssh.PublicKeysCallback(agentClient.Signers))
+	}
+
+	if spec.Identity != "" {
+		keyBytes, err := os.ReadFile(spec.Identity)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read private key %s: %w", spec.Identity, err)
+		}
+
+		var signer ssh.Signer
+		if spec.Passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(keyBytes, []byte(spec.Passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(keyBytes)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key %s: %w", spec.Identity, err)
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+
+	// Fall back to password/keyboard-interactive so hosts without key-based
+	// auth configured keep working the way they always have.
+	methods = append(methods,
+		ssh.Password(spec.Password),
+		ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+			fmt.Println("KeyboardInteractive...")
+			answers := make([]string, len(questions))
+			reader := bufio.NewReader(os.Stdin)
+
+			fmt.Println(instruction) // Print any instruction given by the server.
+
+			for i, question := range questions {
+				fmt.Println("Question:")
+				fmt.Print(question) // Print the question to the user.
+
+				if !echos[i] {
+					// If the echo is false, it's likely asking for a password, so we should not echo the input.
+					if strings.Contains(strings.ToLower(question), "password") {
+						answers[i] = spec.Password
+					}
+				} else {
+					// For other inputs, it's okay to echo what the user types.
+					answer, err := reader.ReadString('\n')
+					if err != nil {
+						return nil, err
+					}
+					answers[i] = strings.TrimSpace(answer)
+				}
+			}
+			return answers, nil
+		}),
+	)
+
+	return methods, nil
+}
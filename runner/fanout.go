@@ -0,0 +1,83 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// FanOutOptions bounds a fan-out run: how many hosts run concurrently, and
+// the overall wall-clock budget for the whole run.
+type FanOutOptions struct {
+	Workers  int
+	Deadline time.Duration
+}
+
+// RunFanOut runs cmd against every host in hosts, up to opts.Workers at a
+// time, and writes one NDJSON Result record per host to out as each
+// completes. A host still running when opts.Deadline elapses is reported
+// with a deadline-exceeded error instead of blocking the run forever.
+func (r *Runner) RunFanOut(hosts []HostSpec, cmd string, opts FanOutOptions, out io.Writer) error {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+
+	ctx := context.Background()
+	var cancel context.CancelFunc
+	if opts.Deadline > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opts.Deadline)
+		defer cancel()
+	}
+
+	sem := make(chan struct{}, workers)
+	results := make(chan Result, len(hosts))
+	var wg sync.WaitGroup
+
+	for _, spec := range hosts {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(spec HostSpec) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results <- r.runOnceWithContext(ctx, spec, cmd)
+		}(spec)
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	enc := json.NewEncoder(out)
+	for result := range results {
+		if err := enc.Encode(result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runOnceWithContext runs RunOnce on a goroutine and races it against ctx, so
+// a single unreachable host can't stall the rest of a fan-out run past its
+// deadline.
+func (r *Runner) runOnceWithContext(ctx context.Context, spec HostSpec, cmd string) Result {
+	resultCh := make(chan Result, 1)
+	go func() {
+		resultCh <- r.RunOnce(spec, cmd)
+	}()
+
+	select {
+	case result := <-resultCh:
+		return result
+	case <-ctx.Done():
+		return Result{
+			Host:       spec.Host,
+			StartedAt:  time.Now(),
+			ExitStatus: -1,
+			Error:      ctx.Err().Error(),
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// LocalForward implements ssh -L semantics: it listens on localAddr and, for
+// each accepted connection, dials remoteAddr through client and copies bytes
+// in both directions until ctx is canceled.
+func LocalForward(ctx context.Context, client *ssh.Client, localAddr, remoteAddr string) error {
+	listener, err := net.Listen("tcp", localAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", localAddr, err)
+	}
+	return serveForward(ctx, listener, func() (net.Conn, error) {
+		return client.Dial("tcp", remoteAddr)
+	})
+}
+
+// RemoteForward implements ssh -R semantics: it asks the server to listen on
+// remoteAddr and, for each connection the server accepts, dials localAddr on
+// this host and copies bytes in both directions until ctx is canceled.
+func RemoteForward(ctx context.Context, client *ssh.Client, remoteAddr, localAddr string) error {
+	listener, err := client.Listen("tcp", remoteAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on remote %s: %w", remoteAddr, err)
+	}
+	return serveForward(ctx, listener, func() (net.Conn, error) {
+		return net.Dial("tcp", localAddr)
+	})
+}
+
+// serveForward accepts connections from listener until ctx is canceled,
+// pairing each with a connection from dialPeer and copying bytes both ways.
+func serveForward(ctx context.Context, listener net.Listener, dialPeer func() (net.Conn, error)) error {
+	defer listener.Close()
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return nil
+			default:
+				return fmt.Errorf("accept failed: %w", err)
+			}
+		}
+
+		go func(near net.Conn) {
+			defer near.Close()
+			far, err := dialPeer()
+			if err != nil {
+				fmt.Printf("forward: failed to dial peer: %s\n", err)
+				return
+			}
+			defer far.Close()
+			stop := context.AfterFunc(ctx, func() {
+				near.Close()
+				far.Close()
+			})
+			defer stop()
+			pipeConns(near, far)
+		}(conn)
+	}
+}
+
+func pipeConns(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	go func() { io.Copy(a, b); done <- struct{}{} }()
+	go func() { io.Copy(b, a); done <- struct{}{} }()
+	<-done
+	<-done
+}
@@ -0,0 +1,120 @@
+package runner
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// askMu serializes "ask" mode's stdin prompt across every host key callback.
+// Without it, concurrent dials from fan-out (runner/fanout.go) could have
+// multiple goroutines read os.Stdin for unrelated hosts at once.
+var askMu sync.Mutex
+
+// buildHostKeyCallback wires up an ssh.HostKeyCallback backed by a
+// known_hosts file, applying OpenSSH-style StrictHostKeyChecking semantics:
+//
+//   - "yes"         unknown or mismatched keys always abort
+//   - "no"          unknown keys are accepted and recorded silently
+//   - "ask"         unknown keys are printed and confirmed on stdin
+//   - "accept-new"  unknown keys are recorded automatically, mismatches abort
+//
+// Key mismatches (a host presenting a different key than the one on file)
+// always abort, regardless of mode, since that's the case known_hosts exists
+// to catch.
+func buildHostKeyCallback(knownHostsPath, strictMode string) (ssh.HostKeyCallback, error) {
+	if knownHostsPath == "" {
+		if strictMode == "no" {
+			return ssh.InsecureIgnoreHostKey(), nil
+		}
+		return nil, fmt.Errorf("-known-hosts is required unless -strict-host-key=no")
+	}
+
+	// knownhosts.New fails if the file doesn't exist yet; that's fine for
+	// TOFU modes, so create an empty file up front. -known-hosts now
+	// defaults to ~/.ssh/known_hosts, so also create that directory the way
+	// ssh-keygen/OpenSSH would if it's missing.
+	if _, err := os.Stat(knownHostsPath); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(knownHostsPath), 0700); err != nil {
+			return nil, fmt.Errorf("failed to create directory for known_hosts file %s: %w", knownHostsPath, err)
+		}
+		f, err := os.OpenFile(knownHostsPath, os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create known_hosts file %s: %w", knownHostsPath, err)
+		}
+		f.Close()
+	}
+
+	base, err := knownhosts.New(knownHostsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load known_hosts file %s: %w", knownHostsPath, err)
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := base(hostname, remote, key)
+		if err == nil {
+			return nil
+		}
+
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) {
+			return err
+		}
+
+		// A non-empty Want list means the host is known under a different
+		// key: always treat that as a hard failure.
+		if len(keyErr.Want) > 0 {
+			return fmt.Errorf("REMOTE HOST IDENTIFICATION HAS CHANGED for %s: %w", hostname, err)
+		}
+
+		// Otherwise the host is simply unknown.
+		fingerprint := ssh.FingerprintSHA256(key)
+		switch strictMode {
+		case "no":
+			return appendKnownHost(knownHostsPath, hostname, key)
+		case "accept-new":
+			fmt.Printf("Warning: permanently added %s (%s) to the list of known hosts.\n", hostname, fingerprint)
+			return appendKnownHost(knownHostsPath, hostname, key)
+		case "ask":
+			askMu.Lock()
+			defer askMu.Unlock()
+			fmt.Printf("The authenticity of host '%s' can't be established.\n", hostname)
+			fmt.Printf("Key fingerprint is %s.\n", fingerprint)
+			fmt.Print("Are you sure you want to continue connecting (yes/no)? ")
+			reader := bufio.NewReader(os.Stdin)
+			answer, _ := reader.ReadString('\n')
+			if strings.TrimSpace(strings.ToLower(answer)) != "yes" {
+				return fmt.Errorf("host key verification refused for %s", hostname)
+			}
+			return appendKnownHost(knownHostsPath, hostname, key)
+		case "yes":
+			return fmt.Errorf("host key verification failed for %s: %w", hostname, err)
+		default:
+			return fmt.Errorf("unknown -strict-host-key mode %q", strictMode)
+		}
+	}, nil
+}
+
+// appendKnownHost records a newly trusted host key, in the same format
+// ssh-keyscan/OpenSSH use, so subsequent connections verify against it.
+func appendKnownHost(knownHostsPath, hostname string, key ssh.PublicKey) error {
+	f, err := os.OpenFile(knownHostsPath, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open known_hosts file %s: %w", knownHostsPath, err)
+	}
+	defer f.Close()
+
+	line := knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key)
+	if _, err := f.WriteString(line + "\n"); err != nil {
+		return fmt.Errorf("failed to write to known_hosts file %s: %w", knownHostsPath, err)
+	}
+	return nil
+}
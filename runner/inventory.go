@@ -0,0 +1,101 @@
+package runner
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadInventory reads a CSV or YAML host inventory, choosing the format by
+// extension (anything not ".csv" is treated as YAML).
+func LoadInventory(path string) ([]HostSpec, error) {
+	if strings.ToLower(filepath.Ext(path)) == ".csv" {
+		return loadInventoryCSV(path)
+	}
+	return loadInventoryYAML(path)
+}
+
+func loadInventoryCSV(path string) ([]HostSpec, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open inventory %s: %w", path, err)
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse inventory %s: %w", path, err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("inventory %s has no rows", path)
+	}
+
+	header := rows[0]
+	columnIndex := make(map[string]int, len(header))
+	for i, name := range header {
+		columnIndex[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columnIndex["host"]; !ok {
+		return nil, fmt.Errorf("inventory %s is missing a required \"host\" column", path)
+	}
+
+	field := func(row []string, name string) string {
+		idx, ok := columnIndex[name]
+		if !ok || idx >= len(row) {
+			return ""
+		}
+		return row[idx]
+	}
+
+	var hosts []HostSpec
+	for _, row := range rows[1:] {
+		hosts = append(hosts, HostSpec{
+			Host:         field(row, "host"),
+			User:         field(row, "user"),
+			Password:     field(row, "password"),
+			Identity:     field(row, "identity"),
+			Passphrase:   field(row, "passphrase"),
+			SudoPassword: field(row, "sudo_password"),
+		})
+	}
+	return hosts, nil
+}
+
+func loadInventoryYAML(path string) ([]HostSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read inventory %s: %w", path, err)
+	}
+
+	var doc struct {
+		Hosts []struct {
+			Host         string `yaml:"host"`
+			User         string `yaml:"user"`
+			Password     string `yaml:"password"`
+			Identity     string `yaml:"identity"`
+			Passphrase   string `yaml:"passphrase"`
+			SudoPassword string `yaml:"sudo_password"`
+		} `yaml:"hosts"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse inventory %s: %w", path, err)
+	}
+
+	hosts := make([]HostSpec, 0, len(doc.Hosts))
+	for _, h := range doc.Hosts {
+		hosts = append(hosts, HostSpec{
+			Host:         h.Host,
+			User:         h.User,
+			Password:     h.Password,
+			Identity:     h.Identity,
+			Passphrase:   h.Passphrase,
+			SudoPassword: h.SudoPassword,
+		})
+	}
+	return hosts, nil
+}
@@ -0,0 +1,134 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+	"unicode/utf8"
+)
+
+// CastRecorder writes an asciinema v2 session recording: a header line
+// followed by one [elapsed_seconds, "o", chunk] record per Write call. Writes
+// are passed through verbatim (no line buffering), so control sequences from
+// a vt100 PTY survive for later replay.
+//
+// asciinema's "o" events carry their chunk as a JSON string, and
+// encoding/json silently replaces invalid UTF-8 with U+FFFD on encode. A
+// Write's chunk is an arbitrary slice off the wire, though, so a multi-byte
+// rune can land split across two reads; pending holds back such a trailing
+// partial sequence until the bytes completing it arrive, so Write never asks
+// json.Marshal to round-trip a broken rune.
+type CastRecorder struct {
+	w       io.Writer
+	start   time.Time
+	pending []byte
+}
+
+// NewCastRecorder writes the asciinema header to w and starts the recording
+// clock. width/height should match the PTY size requested for the session.
+func NewCastRecorder(w io.Writer, width, height int) (*CastRecorder, error) {
+	header := struct {
+		Version   int   `json:"version"`
+		Width     int   `json:"width"`
+		Height    int   `json:"height"`
+		Timestamp int64 `json:"timestamp"`
+	}{Version: 2, Width: width, Height: height, Timestamp: time.Now().Unix()}
+
+	data, err := json.Marshal(header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode cast header: %w", err)
+	}
+	if _, err := fmt.Fprintf(w, "%s\n", data); err != nil {
+		return nil, fmt.Errorf("failed to write cast header: %w", err)
+	}
+
+	return &CastRecorder{w: w, start: time.Now()}, nil
+}
+
+// Write records p as one "o" (output) event, timestamped relative to when
+// the recorder was created. It reports len(p), not the number of bytes
+// actually emitted this call, since any held-back trailing partial rune is
+// still owned by the recorder and will be flushed on a later Write or Flush.
+func (c *CastRecorder) Write(p []byte) (int, error) {
+	n := len(p)
+	data := append(c.pending, p...)
+	c.pending = nil
+
+	if cut := incompleteRuneSuffixLen(data); cut > 0 {
+		c.pending = append(c.pending, data[len(data)-cut:]...)
+		data = data[:len(data)-cut]
+	}
+	if len(data) == 0 {
+		return n, nil
+	}
+
+	if err := c.writeEvent(data); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// Flush emits any trailing partial rune Write is still holding back, even
+// though it never completed. Callers should call it once, after the session
+// output they're recording is done, so the last few bytes of a session
+// aren't silently dropped.
+func (c *CastRecorder) Flush() error {
+	if len(c.pending) == 0 {
+		return nil
+	}
+	data := c.pending
+	c.pending = nil
+	return c.writeEvent(data)
+}
+
+func (c *CastRecorder) writeEvent(data []byte) error {
+	elapsed := time.Since(c.start).Seconds()
+	encoded, err := json.Marshal([]interface{}{elapsed, "o", string(data)})
+	if err != nil {
+		return fmt.Errorf("failed to encode cast event: %w", err)
+	}
+	if _, err := fmt.Fprintf(c.w, "%s\n", encoded); err != nil {
+		return err
+	}
+	return nil
+}
+
+// incompleteRuneSuffixLen scans back up to utf8.UTFMax bytes from the end of
+// data for a lead byte whose encoded length says more continuation bytes
+// should follow than data actually has, and returns how many trailing bytes
+// to hold back. It returns 0 once it finds a complete rune (including a
+// trailing ASCII byte, the common case for terminal output).
+func incompleteRuneSuffixLen(data []byte) int {
+	limit := utf8.UTFMax
+	if limit > len(data) {
+		limit = len(data)
+	}
+	for i := 1; i <= limit; i++ {
+		b := data[len(data)-i]
+		switch {
+		case b&0x80 == 0x00: // ASCII
+			return 0
+		case b&0xC0 == 0x80: // continuation byte; keep scanning back for the lead byte
+			continue
+		case b&0xE0 == 0xC0: // 2-byte lead
+			if i < 2 {
+				return i
+			}
+			return 0
+		case b&0xF0 == 0xE0: // 3-byte lead
+			if i < 3 {
+				return i
+			}
+			return 0
+		case b&0xF8 == 0xF0: // 4-byte lead
+			if i < 4 {
+				return i
+			}
+			return 0
+		default: // not a valid UTF-8 lead byte at all
+			return 0
+		}
+	}
+	return 0
+}
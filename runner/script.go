@@ -0,0 +1,137 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ScriptStep is one entry in a -script file: send a line, then wait for
+// Expect to match before moving on to the next step. This gives an
+// expect(1)-style state machine on top of session.Shell, so a sequence like
+// "enable" -> "Password:" -> config mode -> pager prompts can be driven
+// reliably instead of with fixed sleeps.
+type ScriptStep struct {
+	Send     string `yaml:"send" json:"send"`
+	Expect   string `yaml:"expect" json:"expect"`
+	Timeout  string `yaml:"timeout" json:"timeout"`
+	Optional bool   `yaml:"optional" json:"optional"`
+}
+
+// LoadScript reads a script file, choosing a JSON or YAML decoder based on
+// its extension (anything not ".json" is treated as YAML).
+func LoadScript(path string) ([]ScriptStep, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read script file: %w", err)
+	}
+
+	var steps []ScriptStep
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		err = json.Unmarshal(data, &steps)
+	} else {
+		err = yaml.Unmarshal(data, &steps)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse script file: %w", err)
+	}
+	return steps, nil
+}
+
+// RunScript drives stdin/stdout through steps in order, advancing only once
+// a step's expect pattern matches stdout (or failing once its timeout
+// elapses or stdout ends, unless the step is marked optional). The accumulated output is
+// also offered to sudo, so a privilege-escalation prompt mid-script still
+// gets answered.
+//
+// stdout is read as raw bytes rather than through bufio.Scanner: prompts like
+// "Password:" or a router's "Router#" are written without a trailing
+// newline, since the remote is waiting for a reply on the same line, and a
+// line scanner would never yield them.
+func RunScript(stdout io.Reader, stdin io.Writer, steps []ScriptStep, sudo *sudoHandler) error {
+	const defaultStepTimeout = 5 * time.Second
+	const accumCap = 8192
+
+	chunks := make(chan []byte)
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := stdout.Read(buf)
+			if n > 0 {
+				chunk := make([]byte, n)
+				copy(chunk, buf[:n])
+				chunks <- chunk
+			}
+			if err != nil {
+				close(chunks)
+				return
+			}
+		}
+	}()
+
+	var accum []byte
+	for i, step := range steps {
+		if step.Send != "" {
+			fmt.Fprintf(stdin, "%s\n", step.Send)
+		}
+		if step.Expect == "" {
+			continue
+		}
+
+		expect, err := regexp.Compile(step.Expect)
+		if err != nil {
+			return fmt.Errorf("step %d: invalid expect pattern %q: %w", i, step.Expect, err)
+		}
+
+		timeout := defaultStepTimeout
+		if step.Timeout != "" {
+			timeout, err = time.ParseDuration(step.Timeout)
+			if err != nil {
+				return fmt.Errorf("step %d: invalid timeout %q: %w", i, step.Timeout, err)
+			}
+		}
+
+		matched := expect.Match(accum)
+		deadline := time.After(timeout)
+		outputEnded := false
+	waitForExpect:
+		for !matched {
+			select {
+			case chunk, ok := <-chunks:
+				if !ok {
+					outputEnded = true
+					break waitForExpect
+				}
+				fmt.Print(string(chunk))
+				accum = append(accum, chunk...)
+				if len(accum) > accumCap {
+					accum = accum[len(accum)-accumCap:]
+				}
+				if sudo.MaybeAnswer(string(accum), stdin) {
+					accum = accum[:0]
+					continue
+				}
+				matched = expect.Match(accum)
+			case <-deadline:
+				break waitForExpect
+			}
+		}
+		accum = accum[:0]
+
+		if !matched && !step.Optional {
+			if outputEnded {
+				return fmt.Errorf("step %d: output ended before pattern %q matched", i, step.Expect)
+			}
+			return fmt.Errorf("step %d: timed out after %s waiting for pattern %q", i, timeout, step.Expect)
+		}
+	}
+
+	return nil
+}
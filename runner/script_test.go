@@ -0,0 +1,98 @@
+package runner
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunScript_MatchesAcrossChunkBoundary(t *testing.T) {
+	pr, pw := io.Pipe()
+	var stdin bytes.Buffer
+
+	steps := []ScriptStep{
+		{Send: "enable", Expect: `Password:\s*$`, Timeout: "1s"},
+	}
+
+	go func() {
+		// Split the prompt across two writes with no trailing newline, the
+		// way a real device's bare "Password:" prompt can land split across
+		// reads.
+		pw.Write([]byte("Passwo"))
+		time.Sleep(10 * time.Millisecond)
+		pw.Write([]byte("rd: "))
+		pw.Close()
+	}()
+
+	sudo := newSudoHandler("", "", 0)
+	if err := RunScript(pr, &stdin, steps, sudo); err != nil {
+		t.Fatalf("RunScript failed: %s", err)
+	}
+	if got, want := stdin.String(), "enable\n"; got != want {
+		t.Errorf("stdin = %q, want %q", got, want)
+	}
+}
+
+func TestRunScript_RequiredStepTimesOut(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	var stdin bytes.Buffer
+
+	steps := []ScriptStep{
+		{Send: "show version", Expect: "never-matches", Timeout: "20ms"},
+	}
+
+	sudo := newSudoHandler("", "", 0)
+	err := RunScript(pr, &stdin, steps, sudo)
+	if err == nil {
+		t.Fatal("expected a timeout error, got nil")
+	}
+	if !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("error = %q, want it to mention a timeout", err)
+	}
+}
+
+func TestRunScript_OptionalStepTimesOutSilently(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	var stdin bytes.Buffer
+
+	steps := []ScriptStep{
+		{Send: "terminal length 0", Expect: "never-matches", Timeout: "20ms", Optional: true},
+		{Send: "show version"},
+	}
+
+	sudo := newSudoHandler("", "", 0)
+	if err := RunScript(pr, &stdin, steps, sudo); err != nil {
+		t.Fatalf("RunScript failed: %s", err)
+	}
+	if got, want := stdin.String(), "terminal length 0\nshow version\n"; got != want {
+		t.Errorf("stdin = %q, want %q", got, want)
+	}
+}
+
+func TestRunScript_AnswersSudoPromptMidScript(t *testing.T) {
+	pr, pw := io.Pipe()
+	var stdin bytes.Buffer
+
+	steps := []ScriptStep{
+		{Send: "sudo su", Expect: `\$\s*$`, Timeout: "1s"},
+	}
+
+	go func() {
+		pw.Write([]byte("[sudo] password for bob: "))
+		time.Sleep(10 * time.Millisecond)
+		pw.Write([]byte("\nroot@host:~# $ "))
+		pw.Close()
+	}()
+
+	sudo := newSudoHandler("", "secret", 1)
+	if err := RunScript(pr, &stdin, steps, sudo); err != nil {
+		t.Fatalf("RunScript failed: %s", err)
+	}
+	if got, want := stdin.String(), "sudo su\nsecret\n"; got != want {
+		t.Errorf("stdin = %q, want %q", got, want)
+	}
+}
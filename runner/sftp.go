@@ -0,0 +1,142 @@
+package runner
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// ProgressFunc is called once a file transfer completes, reporting the path
+// transferred and the number of bytes moved.
+type ProgressFunc func(path string, bytes int64)
+
+// NewSFTPClient opens an SFTP session on an already-authenticated SSH client,
+// so put/get/sync share the same hardened ClientConfig as command execution.
+func NewSFTPClient(client *ssh.Client) (*sftp.Client, error) {
+	c, err := sftp.NewClient(client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start sftp session: %w", err)
+	}
+	return c, nil
+}
+
+// Put uploads localPath to remotePath. If localPath is a directory, it is
+// synced recursively, creating remote directories as needed.
+func Put(client *sftp.Client, localPath, remotePath string, progress ProgressFunc) error {
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", localPath, err)
+	}
+	if !info.IsDir() {
+		return putFile(client, localPath, remotePath, progress)
+	}
+
+	return filepath.WalkDir(localPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(localPath, p)
+		if err != nil {
+			return err
+		}
+		remote := path.Join(remotePath, filepath.ToSlash(rel))
+		if d.IsDir() {
+			return client.MkdirAll(remote)
+		}
+		return putFile(client, p, remote, progress)
+	})
+}
+
+func putFile(client *sftp.Client, localPath, remotePath string, progress ProgressFunc) error {
+	if err := client.MkdirAll(path.Dir(remotePath)); err != nil {
+		return fmt.Errorf("failed to create remote directory for %s: %w", remotePath, err)
+	}
+
+	local, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", localPath, err)
+	}
+	defer local.Close()
+
+	remote, err := client.Create(remotePath)
+	if err != nil {
+		return fmt.Errorf("failed to create remote file %s: %w", remotePath, err)
+	}
+	defer remote.Close()
+
+	written, err := io.Copy(remote, local)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", localPath, err)
+	}
+	if progress != nil {
+		progress(remotePath, written)
+	}
+	return nil
+}
+
+// Get downloads remotePath to localPath. If remotePath is a directory, it is
+// synced recursively, creating local directories as needed.
+func Get(client *sftp.Client, remotePath, localPath string, progress ProgressFunc) error {
+	info, err := client.Stat(remotePath)
+	if err != nil {
+		return fmt.Errorf("failed to stat remote %s: %w", remotePath, err)
+	}
+	if !info.IsDir() {
+		return getFile(client, remotePath, localPath, progress)
+	}
+
+	walker := client.Walk(remotePath)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return fmt.Errorf("failed to walk remote %s: %w", remotePath, err)
+		}
+		rel, err := filepath.Rel(remotePath, walker.Path())
+		if err != nil {
+			return err
+		}
+		local := filepath.Join(localPath, filepath.FromSlash(rel))
+		if walker.Stat().IsDir() {
+			if err := os.MkdirAll(local, 0755); err != nil {
+				return fmt.Errorf("failed to create local directory %s: %w", local, err)
+			}
+			continue
+		}
+		if err := getFile(client, walker.Path(), local, progress); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getFile(client *sftp.Client, remotePath, localPath string, progress ProgressFunc) error {
+	if err := os.MkdirAll(filepath.Dir(localPath), 0755); err != nil {
+		return fmt.Errorf("failed to create local directory for %s: %w", localPath, err)
+	}
+
+	remote, err := client.Open(remotePath)
+	if err != nil {
+		return fmt.Errorf("failed to open remote file %s: %w", remotePath, err)
+	}
+	defer remote.Close()
+
+	local, err := os.Create(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", localPath, err)
+	}
+	defer local.Close()
+
+	written, err := io.Copy(local, remote)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", remotePath, err)
+	}
+	if progress != nil {
+		progress(localPath, written)
+	}
+	return nil
+}
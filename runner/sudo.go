@@ -0,0 +1,143 @@
+package runner
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// defaultSudoPromptPattern matches the two prompts sudo(8) and su(1) print
+// most commonly: the bracketed "[sudo] password for user:" form, and a bare
+// "Password:" for anything that shells out to plain su/passwd.
+const defaultSudoPromptPattern = `(?i)(\[sudo\] password for .+:|password:)\s*$`
+
+// sudoHandler watches command output for a privilege-escalation password
+// prompt and answers it on stdin, up to a bounded number of times. It's
+// shared by every mode that streams output (single-host shell, scripted
+// shell, and exec) so they all behave the same way when a command shells out
+// to sudo/su.
+type sudoHandler struct {
+	mu       sync.Mutex
+	prompt   *regexp.Regexp
+	password string
+	retries  int
+	used     int
+}
+
+func newSudoHandler(pattern, password string, retries int) *sudoHandler {
+	if pattern == "" {
+		pattern = defaultSudoPromptPattern
+	}
+	return &sudoHandler{
+		prompt:   regexp.MustCompile(pattern),
+		password: password,
+		retries:  retries,
+	}
+}
+
+// MaybeAnswer writes the sudo password to stdin if chunk looks like a
+// password prompt and the retry budget hasn't been exhausted. It reports
+// whether it answered, so callers can avoid double-counting a match that
+// spans multiple reads. It's safe to call concurrently, since a prompt can
+// land on either stdout or stderr depending on how the remote command was
+// invoked.
+func (s *sudoHandler) MaybeAnswer(chunk string, stdin io.Writer) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.used >= s.retries || !s.prompt.MatchString(chunk) {
+		return false
+	}
+	s.used++
+	fmt.Fprintf(stdin, "%s\n", s.password)
+	return true
+}
+
+// RunExecWithSudo runs cmd on session using Stdout/Stderr/StdinPipe rather
+// than CombinedOutput, so a sudo password prompt on either stream can be
+// answered on stdin instead of the session hanging forever waiting for input
+// that CombinedOutput has no way to provide. It returns stdout and stderr
+// separately, since golang.org/x/crypto/ssh sends stderr to io.Discard
+// unless something is reading it.
+func RunExecWithSudo(session *ssh.Session, cmd string, handler *sudoHandler) (stdout string, stderr string, err error) {
+	stdoutPipe, err := session.StdoutPipe()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to open stdout pipe: %w", err)
+	}
+	stderrPipe, err := session.StderrPipe()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to open stderr pipe: %w", err)
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to open stdin pipe: %w", err)
+	}
+
+	if err := session.Start(cmd); err != nil {
+		return "", "", fmt.Errorf("failed to start command: %w", err)
+	}
+
+	var wg sync.WaitGroup
+	var outBytes, errBytes []byte
+	var outErr, errErr error
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		outBytes, outErr = readWithSudo(stdoutPipe, stdin, handler)
+	}()
+	go func() {
+		defer wg.Done()
+		errBytes, errErr = readWithSudo(stderrPipe, stdin, handler)
+	}()
+	wg.Wait()
+
+	stdout, stderr = string(outBytes), string(errBytes)
+	if outErr != nil {
+		return stdout, stderr, fmt.Errorf("failed reading command stdout: %w", outErr)
+	}
+	if errErr != nil {
+		return stdout, stderr, fmt.Errorf("failed reading command stderr: %w", errErr)
+	}
+
+	if err := session.Wait(); err != nil {
+		return stdout, stderr, fmt.Errorf("command exited with error: %w", err)
+	}
+	return stdout, stderr, nil
+}
+
+// readWithSudo reads r to completion, returning everything it saw. A sudo or
+// su password prompt is written without a trailing newline (the remote is
+// waiting for the reply on the same line), so this can't use bufio.Scanner,
+// which only yields on '\n' or EOF and would never see the prompt at all.
+// Reading raw bytes instead and offering a bounded trailing window to the
+// handler after every read lets it catch a prompt on either stdout or
+// stderr, whichever the remote command used.
+func readWithSudo(r io.Reader, stdin io.Writer, handler *sudoHandler) ([]byte, error) {
+	var output []byte
+	var accum []byte
+	const accumCap = 8192
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			chunk := buf[:n]
+			output = append(output, chunk...)
+			accum = append(accum, chunk...)
+			if len(accum) > accumCap {
+				accum = accum[len(accum)-accumCap:]
+			}
+			if handler.MaybeAnswer(string(accum), stdin) {
+				accum = accum[:0]
+			}
+		}
+		if err == io.EOF {
+			return output, nil
+		}
+		if err != nil {
+			return output, err
+		}
+	}
+}